@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	adminReposPath   = "/_admin/repos"
+	adminHealthzPath = "/_admin/healthz"
+
+	bearerPrefix = "Bearer "
+)
+
+// adminRepo is the JSON representation of a repo returned by
+// GET /_admin/repos.
+type adminRepo struct {
+	Name       string    `json:"name"`
+	LastUpdate time.Time `json:"last_update,omitempty"`
+	HeadSHA    string    `json:"head_sha,omitempty"`
+	InFlight   bool      `json:"in_flight"`
+	QueueDepth int       `json:"queue_depth"`
+}
+
+// adminAPI serves gitup's admin endpoints, authenticated with a bearer
+// token: GET /_admin/repos, POST /_admin/repos/:name/update and
+// GET /_admin/healthz.
+func adminAPI(repos Repos, scheduler *Scheduler, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminHealthzPath, healthzHandler)
+	mux.HandleFunc(adminReposPath, listReposHandler(repos))
+	mux.HandleFunc(adminReposPath+"/", triggerUpdateHandler(repos, scheduler))
+
+	return requireBearerToken(token, mux)
+}
+
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, bearerPrefix) ||
+			!hmac.Equal([]byte(auth[len(bearerPrefix):]), []byte(token)) {
+			http.Error(w, "invalid or missing admin token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(okBody))
+}
+
+func listReposHandler(repos Repos) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+
+		list := make([]adminRepo, 0, len(repos))
+		for _, repo := range repos {
+			ar := adminRepo{Name: repo.Name}
+			ar.LastUpdate, ar.HeadSHA = repo.StatusSnapshot()
+
+			running, pending := repo.QueueStatus()
+			ar.InFlight = running
+			if pending {
+				ar.QueueDepth = 1
+			}
+
+			list = append(list, ar)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+func triggerUpdateHandler(repos Repos, scheduler *Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/update") {
+			http.NotFound(w, r)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, adminReposPath+"/")
+		name = strings.TrimSuffix(name, "/update")
+
+		repo := repos.FindRepo(name)
+		if repo == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		jobID := scheduler.Trigger(repo)
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(jobID))
+	}
+}
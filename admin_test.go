@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	h := requireBearerToken("right-token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantStatus int
+	}{
+		{"valid token", "Bearer right-token", http.StatusOK},
+		{"wrong token", "Bearer wrong-token", http.StatusUnauthorized},
+		{"missing prefix", "right-token", http.StatusUnauthorized},
+		{"missing header", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error creating request: %s", test.name, err)
+		}
+		if test.authHeader != "" {
+			req.Header.Set("Authorization", test.authHeader)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error executing request: %s", test.name, err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.wantStatus {
+			t.Errorf("%s: expected status %d, but got %d", test.name, test.wantStatus, res.StatusCode)
+		}
+	}
+}
+
+func TestListReposHandler(t *testing.T) {
+	repos := Repos{
+		"example.com": {
+			Name: "username/repo",
+			VCS:  &fakeVCS{started: make(chan struct{}), proceed: closedChan()},
+		},
+	}
+
+	srv := httptest.NewServer(adminAPI(repos, newScheduler(0), "token"))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+adminReposPath, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error executing request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, but got %d", http.StatusOK, res.StatusCode)
+	}
+
+	var got []adminRepo
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("Unexpected error decoding response: %s", err)
+	}
+
+	if len(got) != 1 || got[0].Name != "username/repo" {
+		t.Fatalf("Expected a single entry for username/repo, but got %#v", got)
+	}
+	if got[0].InFlight {
+		t.Fatalf("Expected InFlight to be false for a repo with no update running, but got true")
+	}
+}
+
+func TestTriggerUpdateHandler(t *testing.T) {
+	repos := Repos{
+		"example.com": {
+			Name: "username/repo",
+			VCS:  &fakeVCS{started: make(chan struct{}), proceed: closedChan()},
+		},
+	}
+
+	srv := httptest.NewServer(adminAPI(repos, newScheduler(0), "token"))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+adminReposPath+"/username/repo/update", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error executing request: %s", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status %d, but got %d", http.StatusAccepted, res.StatusCode)
+	}
+
+	waitForQueueIdle(t, repos["example.com"])
+}
+
+// closedChan returns a channel that's already closed, for fakeVCS
+// instances that should never actually block in a test.
+func closedChan() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"errors"
-	"os/exec"
 	"sync"
+	"time"
 )
 
 type Repos map[string]*Repo
@@ -19,26 +18,88 @@ func (r Repos) FindRepo(name string) *Repo {
 }
 
 type Repo struct {
-	Name    string     // Name of the repo on GitHub, so Thomasdezeeuw/gitup.
-	Path    string     // Full path to git repo.
-	Secret  string     // Optional secrect from GitHub.
-	GitPath string     // Full path to the git command.
-	mu      sync.Mutex // Protects the git update command.
+	Name       string     // Name of the repo on GitHub, so Thomasdezeeuw/gitup.
+	Path       string     // Full path to git repo.
+	Secret     string     // Optional secrect from GitHub.
+	GitPath    string     // Full path to the git command.
+	VCS        VCS        // Driver used to bring Path up to date with its remote.
+	Provider   Provider   // Forge whose webhook protocol this repo's requests use.
+	Branch     string     // Branch to update to, used by the checkout mode.
+	Mode       string     // Update strategy: pull, reset, checkout or rebase.
+	PreUpdate  []string   // Commands run, in order, before the update.
+	PostUpdate []string   // Commands run, in order, after a successful update.
+	Serve      bool       // Whether to expose this repo over smart-HTTP.
+	AllowPush  bool       // Whether smart-HTTP clients may git-receive-pack.
+	LFS        bool       // Whether to fetch and checkout Git LFS objects after the update.
+	Submodules string     // Submodule handling: none, shallow or recursive.
+	LastUpdate time.Time  // When Update last completed successfully.
+	mu         sync.Mutex // Protects the update and LastUpdate.
+
+	running bool       // Whether an update is currently in progress.
+	pending bool       // Whether a further update has been coalesced into the one in progress.
+	jobID   string     // Job id of the in-progress (or last coalesced) update.
+	queueMu sync.Mutex // Protects running, pending and jobID; held only briefly, never across an update.
+}
+
+// QueueStatus reports whether r is currently updating and whether a
+// further update is queued (coalesced) behind it.
+func (r *Repo) QueueStatus() (running, pending bool) {
+	r.queueMu.Lock()
+	defer r.queueMu.Unlock()
+	return r.running, r.pending
 }
 
-// todo: add a custom command and run it.
-func (r *Repo) Update() error {
+// StatusSnapshot reports when r last finished updating and the SHA its
+// worktree currently has checked out, taking r.mu so neither is read
+// concurrently with updateOnce writing LastUpdate or driving r.VCS
+// through a fetch/reset. headSHA is empty if CurrentRef fails.
+func (r *Repo) StatusSnapshot() (lastUpdate time.Time, headSHA string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	var buf bytes.Buffer
-	cmd := exec.Command(r.GitPath, "pull", "--force")
-	cmd.Stdout = &buf
-	cmd.Stderr = &buf
+	if sha, err := r.VCS.CurrentRef(); err == nil {
+		headSHA = sha
+	}
+	return r.LastUpdate, headSHA
+}
+
+// updateOnce runs a single update of r: pre-update hooks, a fetch, the
+// configured update mode, an LFS fetch and submodule update if
+// configured, then post-update hooks.
+func (r *Repo) updateOnce() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, err := runHooks(r.PreUpdate, r.Path)
+	if err != nil {
+		return errors.New(err.Error() + ": " + out)
+	}
+
+	if err := r.VCS.Fetch(); err != nil {
+		return err
+	}
+
+	if err := runMode(r.VCS, r.Mode, r.Branch); err != nil {
+		return err
+	}
 
-	err := cmd.Run()
-	if err == nil {
-		return nil
+	if r.LFS {
+		if err := r.VCS.FetchLFS(); err != nil {
+			return err
+		}
 	}
-	return errors.New(err.Error() + ": " + buf.String())
+
+	if r.Submodules != "" && r.Submodules != submodulesNone {
+		if err := r.VCS.UpdateSubmodules(r.Submodules); err != nil {
+			return err
+		}
+	}
+
+	out, err = runHooks(r.PostUpdate, r.Path)
+	if err != nil {
+		return errors.New(err.Error() + ": " + out)
+	}
+
+	r.LastUpdate = time.Now()
+	return nil
 }
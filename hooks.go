@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// runHooks runs each command in cmds in dir using the shell, in order,
+// stopping at the first failure. It returns the combined stdout/stderr
+// of every command that ran, so it can be folded into Repo.Update's
+// error report.
+func runHooks(cmds []string, dir string) (string, error) {
+	var out bytes.Buffer
+
+	for _, c := range cmds {
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Dir = dir
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+
+		if err := cmd.Run(); err != nil {
+			return out.String(), fmt.Errorf("hook %q: %s", c, err)
+		}
+	}
+
+	return out.String(), nil
+}
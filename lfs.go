@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	lfsMediaType    = "application/vnd.git-lfs+json"
+	lfsOperation    = "download"
+	lfsPointerMagic = "version https://git-lfs.github.com/spec/v1"
+)
+
+// lfsTransferAdapters are the transfer adapters gitup offers the LFS
+// server, in the order it's willing to use them. Only "basic" (plain
+// HTTPS upload/download) is implemented.
+var lfsTransferAdapters = []string{"basic"}
+
+var (
+	errLFSHTTPRemoteOnly = errors.New("lfs is only supported over an http(s) remote with the gogit driver")
+	errLFSBadResponse    = errors.New("lfs server returned an unexpected response")
+)
+
+// lfsPointer is a parsed Git LFS pointer file, the small text stub
+// checked into the repo in place of the actual object.
+type lfsPointer struct {
+	Path string // Path of the pointer file, relative to the worktree root.
+	Oid  string // Hex-encoded sha256, without the "sha256:" prefix.
+	Size int64
+}
+
+type lfsBatchRequest struct {
+	Operation string             `json:"operation"`
+	Transfers []string           `json:"transfers"`
+	Objects   []lfsObjectRequest `json:"objects"`
+}
+
+type lfsObjectRequest struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchResponse struct {
+	Transfer string           `json:"transfer"`
+	Objects  []lfsBatchObject `json:"objects"`
+}
+
+type lfsBatchObject struct {
+	Oid     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions"`
+	Error   *lfsObjectError      `json:"error"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// fetchLFS downloads the Git LFS objects referenced by pointer files
+// checked out in repo's worktree and smudges them into place, driving
+// the LFS batch API (`POST /objects/batch`) directly since go-git has
+// no LFS client of its own. It mirrors `git lfs fetch --all && git lfs
+// checkout` for the gogit driver.
+func fetchLFS(repo *git.Repository, path, remote, token string) error {
+	pointers, err := findLFSPointers(path)
+	if err != nil {
+		return err
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	endpoint, err := lfsBatchEndpoint(repo, remote)
+	if err != nil {
+		return err
+	}
+
+	batch, err := requestLFSBatch(endpoint, token, pointers)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range batch.Objects {
+		if obj.Error != nil {
+			return fmt.Errorf("lfs object %s: %s", obj.Oid, obj.Error.Message)
+		}
+
+		action, ok := obj.Actions[lfsOperation]
+		if !ok {
+			// Nothing to download for this object, e.g. it's empty.
+			continue
+		}
+
+		pointer := pointerByOid(pointers, obj.Oid)
+		if pointer == nil {
+			continue
+		}
+
+		if err := downloadLFSObject(action, filepath.Join(path, pointer.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findLFSPointers walks path looking for Git LFS pointer files, which
+// are small text files starting with lfsPointerMagic.
+func findLFSPointers(path string) ([]lfsPointer, error) {
+	var pointers []lfsPointer
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Pointer files are always small; skip anything that can't be one.
+		if info.Size() > 1024 {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		pointer, ok := parseLFSPointer(data)
+		if !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		pointer.Path = rel
+		pointers = append(pointers, pointer)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pointers, nil
+}
+
+// parseLFSPointer parses the three required lines of a Git LFS pointer
+// file: the version line, the "oid sha256:<hex>" line and the "size
+// <bytes>" line.
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	if !bytes.HasPrefix(data, []byte(lfsPointerMagic)) {
+		return lfsPointer{}, false
+	}
+
+	var pointer lfsPointer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "oid sha256:"):
+			pointer.Oid = strings.TrimPrefix(line, "oid sha256:")
+		case strings.HasPrefix(line, "size "):
+			size, err := strconv.ParseInt(strings.TrimPrefix(line, "size "), 10, 64)
+			if err != nil {
+				return lfsPointer{}, false
+			}
+			pointer.Size = size
+		}
+	}
+
+	if pointer.Oid == "" || pointer.Size == 0 {
+		return lfsPointer{}, false
+	}
+	return pointer, true
+}
+
+func pointerByOid(pointers []lfsPointer, oid string) *lfsPointer {
+	for i := range pointers {
+		if pointers[i].Oid == oid {
+			return &pointers[i]
+		}
+	}
+	return nil
+}
+
+// lfsBatchEndpoint derives the LFS batch API endpoint for remote,
+// following the convention every LFS server implements: the remote's
+// clone URL with ".git" appended (if not already present) and
+// "/info/lfs" appended to that.
+func lfsBatchEndpoint(repo *git.Repository, remote string) (string, error) {
+	r, err := repo.Remote(remote)
+	if err != nil {
+		return "", err
+	}
+
+	urls := r.Config().URLs
+	if len(urls) == 0 {
+		return "", errLFSHTTPRemoteOnly
+	}
+
+	url := urls[0]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", errLFSHTTPRemoteOnly
+	}
+
+	if !strings.HasSuffix(url, ".git") {
+		url += ".git"
+	}
+	return url + "/info/lfs", nil
+}
+
+// requestLFSBatch drives the LFS batch API's "download" operation for
+// pointers, offering lfsTransferAdapters as the set of transfer
+// adapters gitup can speak.
+func requestLFSBatch(endpoint, token string, pointers []lfsPointer) (*lfsBatchResponse, error) {
+	objects := make([]lfsObjectRequest, len(pointers))
+	for i, p := range pointers {
+		objects[i] = lfsObjectRequest{Oid: p.Oid, Size: p.Size}
+	}
+
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: lfsOperation,
+		Transfers: lfsTransferAdapters,
+		Objects:   objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", lfsMediaType)
+	req.Header.Set("Accept", lfsMediaType)
+	if token != "" {
+		req.SetBasicAuth("gitup", token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: batch request returned %s", errLFSBadResponse, res.Status)
+	}
+
+	var batch lfsBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// downloadLFSObject fetches the object described by action and
+// smudges it into place at path, overwriting the pointer file.
+func downloadLFSObject(action lfsAction, path string) error {
+	req, err := http.NewRequest(http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: download of %s returned %s", errLFSBadResponse, path, res.Status)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".lfs-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, res.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestParseLFSPointer(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   lfsPointer
+		wantOk bool
+	}{
+		{
+			name: "valid pointer",
+			data: lfsPointerMagic + "\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n",
+			want: lfsPointer{
+				Oid:  "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393",
+				Size: 12345,
+			},
+			wantOk: true,
+		},
+		{
+			name:   "not a pointer file",
+			data:   "just a regular file\n",
+			wantOk: false,
+		},
+		{
+			name:   "missing oid",
+			data:   lfsPointerMagic + "\nsize 12345\n",
+			wantOk: false,
+		},
+		{
+			name:   "missing size",
+			data:   lfsPointerMagic + "\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n",
+			wantOk: false,
+		},
+		{
+			name:   "non-numeric size",
+			data:   lfsPointerMagic + "\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize abc\n",
+			wantOk: false,
+		},
+	}
+
+	for _, test := range tests {
+		got, ok := parseLFSPointer([]byte(test.data))
+		if ok != test.wantOk {
+			t.Errorf("%s: ok = %t, want %t", test.name, ok, test.wantOk)
+			continue
+		}
+		if ok && (got.Oid != test.want.Oid || got.Size != test.want.Size) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindLFSPointers(t *testing.T) {
+	dir := t.TempDir()
+
+	pointerBody := lfsPointerMagic + "\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 42\n"
+	if err := os.WriteFile(filepath.Join(dir, "model.bin"), []byte(pointerBody), 0o644); err != nil {
+		t.Fatalf("Unexpected error writing pointer file: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not lfs\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error writing regular file: %s", err)
+	}
+
+	sub := filepath.Join(dir, "assets")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatalf("Unexpected error creating subdirectory: %s", err)
+	}
+	subPointerBody := lfsPointerMagic + "\noid sha256:0000000000000000000000000000000000000000000000000000000000000f\nsize 7\n"
+	if err := os.WriteFile(filepath.Join(sub, "texture.png"), []byte(subPointerBody), 0o644); err != nil {
+		t.Fatalf("Unexpected error writing nested pointer file: %s", err)
+	}
+
+	// A .git directory should never be walked into.
+	gitDir := filepath.Join(dir, ".git")
+	if err := os.Mkdir(gitDir, 0o755); err != nil {
+		t.Fatalf("Unexpected error creating .git directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte(pointerBody), 0o644); err != nil {
+		t.Fatalf("Unexpected error writing into .git: %s", err)
+	}
+
+	pointers, err := findLFSPointers(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error finding pointers: %s", err)
+	}
+
+	if len(pointers) != 2 {
+		t.Fatalf("Expected 2 pointers, but got %d: %+v", len(pointers), pointers)
+	}
+
+	found := map[string]bool{}
+	for _, p := range pointers {
+		found[p.Path] = true
+	}
+	if !found["model.bin"] || !found[filepath.Join("assets", "texture.png")] {
+		t.Fatalf("Expected model.bin and assets/texture.png to be found, got %+v", pointers)
+	}
+}
+
+func TestLFSBatchEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantEnd string
+		wantErr bool
+	}{
+		{"https url without .git suffix", "https://example.com/username/repo", "https://example.com/username/repo.git/info/lfs", false},
+		{"https url with .git suffix", "https://example.com/username/repo.git", "https://example.com/username/repo.git/info/lfs", false},
+		{"ssh url is unsupported", "git@example.com:username/repo.git", "", true},
+	}
+
+	for _, test := range tests {
+		repo, err := git.Init(memory.NewStorage(), nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error initializing repo: %s", test.name, err)
+		}
+		if _, err := repo.CreateRemote(&config.RemoteConfig{
+			Name: defaultRemote,
+			URLs: []string{test.url},
+		}); err != nil {
+			t.Fatalf("%s: unexpected error creating remote: %s", test.name, err)
+		}
+
+		got, err := lfsBatchEndpoint(repo, defaultRemote)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, wantErr %t", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && got != test.wantEnd {
+			t.Errorf("%s: endpoint = %q, want %q", test.name, got, test.wantEnd)
+		}
+	}
+}
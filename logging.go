@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+)
+
+// webhookLogEntry is the structured record written for every webhook
+// request gitup handles.
+type webhookLogEntry struct {
+	Repo          string `json:"repo"`
+	Event         string `json:"event"`
+	SignatureOK   bool   `json:"signature_ok"`
+	DurationMS    int64  `json:"duration_ms"`
+	GitExitStatus int    `json:"git_exit_status"`
+	JobID         string `json:"job_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// logWebhook writes e to the standard logger as a single line of JSON.
+func logWebhook(e webhookLogEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("gitup: failed to marshal log entry: %s", err)
+		return
+	}
+	log.Println(string(b))
+}
+
+var exitStatusRe = regexp.MustCompile(`^exit status (\d+)`)
+
+// gitExitStatus extracts the exit status CLIGit prefixes its errors
+// with, or -1 if err is nil or didn't come from a git invocation.
+func gitExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	m := exitStatusRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return -1
+	}
+
+	var status int
+	for _, c := range m[1] {
+		status = status*10 + int(c-'0')
+	}
+	return status
+}
@@ -1,37 +1,60 @@
+// gitup listens for forge webhooks and brings local mirrors of the
+// repos they reference up to date. The binary used to be built from
+// cmd/gitup/main.go instead; that copy predated the VCS/driver
+// refactor, never referenced the Repo/VCS types the rest of this
+// package is built around, and didn't compile on its own, so it was
+// dropped in favour of this single entrypoint rather than kept in
+// sync by hand.
 package main
 
 import (
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/hex"
+	"context"
 	"errors"
-	"io"
+	"flag"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Thomasdezeeuw/ini"
 )
 
 const (
-	urlPrefix       = "/update"
-	eventTypeHeader = "X-GitHub-Event"
-	signatureHeader = "X-Hub-Signature"
-	signaturePrefix = "sha1="
-	pushEventType   = "push"
+	urlPrefix = "/update"
 
 	okBody = "OK"
+
+	portDesc  = "Port to listen on"
+	shorthand = " (shorthand)"
+
+	shutdownTimeout = 30 * time.Second
+)
+
+var (
+	errInvalidSignature = errors.New("invalid signature header")
+	errProviderMismatch = errors.New("request does not match the repo's configured provider")
+
+	port = 8080
+
+	// activeUpdates tracks in-flight Repo.Update calls so a graceful
+	// shutdown can drain them before the process exits.
+	activeUpdates sync.WaitGroup
 )
 
-var errInvalidSignature = errors.New("invalid signature header")
+func init() {
+	flag.IntVar(&port, "port", port, portDesc)
+	flag.IntVar(&port, "p", port, portDesc+shorthand)
+}
 
 func main() {
-	// todo: make port configurable.
-	// todo: add flag to overwrite.
-	configPath := "./config.ini"
-	address := ":8080"
+	configPath, address := pareseFlags()
 
 	conf, err := parseConfig(configPath)
 	if err != nil {
@@ -51,8 +74,71 @@ func main() {
 		exit(err)
 	}
 
-	h := update(repos)
-	http.ListenAndServe(address, h)
+	maxConcurrent, _ := strconv.Atoi(conf[ini.Global]["max_concurrent_updates"])
+	scheduler := newScheduler(maxConcurrent)
+
+	mux := http.NewServeMux()
+	mux.Handle(urlPrefix+"/", update(repos, scheduler))
+
+	if token := conf[ini.Global]["admin_token"]; token != "" {
+		mux.Handle("/_admin/", adminAPI(repos, scheduler, token))
+	}
+
+	if anyServed(repos) {
+		gitHTTPBackend, err := getGitHTTPBackendPath()
+		if err != nil {
+			// todo: check if the error makes sense...
+			exit(err)
+		}
+		mux.Handle("/", serveGit(repos, gitHTTPBackend))
+	}
+
+	srv := &http.Server{Addr: address, Handler: mux}
+	runAndShutdownGracefully(srv)
+}
+
+// runAndShutdownGracefully serves srv until SIGINT/SIGTERM, then stops
+// accepting new connections and waits for in-flight updates to finish
+// before returning.
+func runAndShutdownGracefully(srv *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	idleClosed := make(chan struct{})
+	go func() {
+		<-sig
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			os.Stderr.WriteString(err.Error())
+		}
+
+		// srv.Shutdown has already stopped new connections from
+		// reaching the webhook/admin handlers, so no further updates
+		// can be triggered; it's now safe to wait for the ones
+		// already in flight to finish draining.
+		activeUpdates.Wait()
+		close(idleClosed)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		exit(err)
+	}
+	<-idleClosed
+}
+
+func pareseFlags() (configPath, address string) {
+	flag.Parse()
+
+	configPath = flag.Arg(0)
+	if configPath == "" {
+		configPath = "./config.ini"
+	}
+
+	address = ":" + strconv.Itoa(port)
+
+	return configPath, address
 }
 
 func exit(err error) {
@@ -99,23 +185,81 @@ func createRepos(conf ini.Config, path, gitPath string) (Repos, error) {
 }
 
 func createRepo(conf map[string]string, dir, gitPath string) (*Repo, error) {
-	path := filepath.Join(dir, conf["path"])
-	path, err := filepath.Abs(path)
+	path := filepath.Clean(conf["path"])
+	if !strings.HasPrefix(path, string(filepath.Separator)) {
+		path = filepath.Join(dir, path)
+
+		ppath, err := filepath.Abs(path)
+		if err != nil {
+			return &Repo{}, err
+		}
+		path = ppath
+	}
+
+	vcs, err := newVCS(conf, path, gitPath)
+	if err != nil {
+		return &Repo{}, err
+	}
+
+	provider, err := providerFor(conf["provider"])
 	if err != nil {
 		return &Repo{}, err
 	}
 
+	branch := conf["branch"]
+	if branch == "" {
+		branch = defaultBranch
+	}
+
 	repo := Repo{
-		Name:    conf["name"],
-		Path:    path,
-		Secret:  conf["secret"],
-		GitPath: gitPath,
+		Name:       conf["name"],
+		Path:       path,
+		Secret:     conf["secret"],
+		GitPath:    gitPath,
+		VCS:        vcs,
+		Provider:   provider,
+		Branch:     branch,
+		Mode:       conf["mode"],
+		PreUpdate:  splitCommands(conf["pre_update"]),
+		PostUpdate: splitCommands(conf["post_update"]),
+		Serve:      conf["serve"] == "true",
+		AllowPush:  conf["allow_push"] == "true",
+		LFS:        conf["lfs"] == "true",
+		Submodules: conf["submodules"],
 	}
 
 	return &repo, nil
 }
 
-func update(repos Repos) http.HandlerFunc {
+// anyServed reports whether at least one repo has `serve = true`, in
+// which case gitup needs git-http-backend to serve it.
+func anyServed(repos Repos) bool {
+	for _, repo := range repos {
+		if repo.Serve {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommands splits a `;`-separated list of shell commands from a
+// config value into individual commands, discarding empty entries.
+func splitCommands(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var cmds []string
+	for _, c := range strings.Split(value, ";") {
+		c = strings.TrimSpace(c)
+		if c != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+func update(repos Repos, scheduler *Scheduler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		URL := strings.TrimSuffix(r.URL.String(), "/")
 
@@ -133,52 +277,45 @@ func update(repos Repos) http.HandlerFunc {
 			return
 		}
 
-		// Ignore events other then push and ping.
-		if eventType := r.Header.Get(eventTypeHeader); eventType != pushEventType {
-			w.Write([]byte(okBody))
-			return
-		}
+		start := time.Now()
+		entry := webhookLogEntry{Repo: repo.Name}
+		defer func() {
+			entry.DurationMS = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+			logWebhook(entry)
+		}()
 
-		signature := r.Header.Get(signatureHeader)
-		if !isValidSignature(signature, repo.Secret, r.Body) {
-			http.Error(w, errInvalidSignature.Error(), http.StatusForbidden)
+		if !repo.Provider.Match(r) {
+			entry.Error = errProviderMismatch.Error()
+			http.Error(w, errProviderMismatch.Error(), http.StatusBadRequest)
 			return
 		}
 
-		if err := repo.Update(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			entry.Error = err.Error()
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		w.Write([]byte(okBody))
-	})
-}
-
-func isValidSignature(signature, secret string, r io.Reader) bool {
-	actual, err := decodeSignatureHeader(signature)
-	if err != nil {
-		return false
-	}
+		entry.Event = repo.Provider.EventKind(r)
 
-	mac := hmac.New(sha1.New, []byte(secret))
-	io.Copy(mac, r)
-	expected := mac.Sum(nil)
-
-	return hmac.Equal(expected, actual)
-}
+		// Ignore events other then push and ping.
+		if entry.Event != pushKind {
+			w.Write([]byte(okBody))
+			return
+		}
 
-func decodeSignatureHeader(signature string) ([]byte, error) {
-	if !strings.HasPrefix(signature, signaturePrefix) {
-		return []byte{}, errInvalidSignature
-	}
-	signature = signature[len(signaturePrefix):]
+		if err := repo.Provider.Verify(repo.Secret, body, r); err != nil {
+			entry.Error = err.Error()
+			http.Error(w, errInvalidSignature.Error(), http.StatusForbidden)
+			return
+		}
+		entry.SignatureOK = true
 
-	var actual = make([]byte, 50)
-	n, err := hex.Decode(actual, []byte(signature))
-	if err != nil {
-		return []byte{}, errInvalidSignature
-	}
-	actual = actual[:n]
+		jobID := scheduler.Trigger(repo)
+		entry.JobID = jobID
 
-	return actual, nil
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(jobID))
+	})
 }
@@ -121,6 +121,14 @@ func TestCreateRepos(t *testing.T) {
 			Path:    filepath.Join(path, "repo"),
 			Secret:  "my-secret",
 			GitPath: gitPath,
+			VCS: &CLIGit{
+				Path:    filepath.Join(path, "repo"),
+				GitPath: gitPath,
+				Remote:  defaultRemote,
+				Branch:  defaultBranch,
+			},
+			Provider: githubProvider{},
+			Branch:   defaultBranch,
 		},
 	}
 
@@ -168,10 +176,17 @@ func TestUpdateHandler(t *testing.T) {
 			Path:    repoPath,
 			Secret:  "my-secret",
 			GitPath: "git",
+			VCS: &CLIGit{
+				Path:    repoPath,
+				GitPath: "git",
+				Remote:  defaultRemote,
+				Branch:  defaultBranch,
+			},
+			Provider: githubProvider{},
 		},
 	}
 
-	h := update(repos)
+	h := update(repos, newScheduler(0))
 	srv := httptest.NewServer(h)
 	defer srv.Close()
 
@@ -186,25 +201,25 @@ func TestUpdateHandler(t *testing.T) {
 		t.Fatalf("Unexpected error executing request: %s", err.Error())
 	}
 
-	// todo: create a working repo with a working origin.
-	expected := "exit status 1: fatal: No remote repository specified.  Please, specify either a URL or a\nremote name from which new revisions should be fetched.\n\n"
-	err = checkBody(res, http.StatusInternalServerError, expected)
-	if err != nil {
-		t.Fatal(err.Error())
+	// The update itself now runs in the background; the handler only
+	// has to accept the job.
+	if got := res.StatusCode; got != http.StatusAccepted {
+		t.Fatalf("Expected status code to be %d, but got %d", http.StatusAccepted, got)
 	}
 }
 
 func TestInvalidSignature(t *testing.T) {
 	repos := Repos{
 		"example.com": {
-			Name:    "username/repo",
-			Path:    filepath.Join("./", "git-repo"),
-			Secret:  "my-secret",
-			GitPath: "git",
+			Name:     "username/repo",
+			Path:     filepath.Join("./", "git-repo"),
+			Secret:   "my-secret",
+			GitPath:  "git",
+			Provider: githubProvider{},
 		},
 	}
 
-	h := update(repos)
+	h := update(repos, newScheduler(0))
 	srv := httptest.NewServer(h)
 	defer srv.Close()
 
@@ -231,7 +246,7 @@ func createUpdateRequest(URL, body, secret string) (*http.Request, error) {
 		return nil, err
 	}
 
-	req.Header.Set("X-Github-Event", pushEventType)
+	req.Header.Set("X-Github-Event", pushKind)
 	req.Header.Set("X-Hub-Signature", createSignature(body, secret))
 
 	return req, nil
@@ -242,7 +257,7 @@ func createSignature(body, secret string) string {
 	c.Write([]byte(body))
 	q := c.Sum(nil)
 
-	return signaturePrefix + hex.EncodeToString(q)
+	return "sha1=" + hex.EncodeToString(q)
 }
 
 func checkBody(res *http.Response, statusCode int, body string) error {
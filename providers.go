@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+)
+
+const (
+	providerGitHub    = "github"
+	providerGitLab    = "gitlab"
+	providerGitea     = "gitea"
+	providerBitbucket = "bitbucket"
+
+	pushKind = "push"
+)
+
+// Provider abstracts the parts of a forge's webhook protocol gitup
+// needs: how to recognise a request as coming from it, how to verify
+// its authenticity, and how to read the event kind out of it. This
+// lets the same /update handler serve repos hosted on different
+// forges.
+type Provider interface {
+	// Match reports whether r looks like a webhook from this provider.
+	Match(r *http.Request) bool
+	// Verify checks body against the signature or token r carries,
+	// returning an error if it doesn't match secret.
+	Verify(secret string, body []byte, r *http.Request) error
+	// EventKind returns the normalised event kind, so pushKind for any
+	// flavour of push event.
+	EventKind(r *http.Request) string
+}
+
+var providers = map[string]Provider{
+	providerGitHub:    githubProvider{},
+	providerGitLab:    gitlabProvider{},
+	providerGitea:     giteaProvider{},
+	providerBitbucket: bitbucketProvider{},
+}
+
+var errUnknownProvider = errors.New("unknown provider, must be \"github\", \"gitlab\", \"gitea\" or \"bitbucket\"")
+
+// providerFor looks up the Provider for the `provider` config key. An
+// empty name defaults to GitHub, preserving gitup's original behaviour.
+func providerFor(name string) (Provider, error) {
+	if name == "" {
+		name = providerGitHub
+	}
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	return p, nil
+}
+
+// githubProvider implements GitHub's webhook protocol: the
+// X-GitHub-Event/X-Hub-Signature(-256) headers.
+type githubProvider struct{}
+
+func (githubProvider) Match(r *http.Request) bool {
+	return r.Header.Get("X-GitHub-Event") != ""
+}
+
+func (githubProvider) Verify(secret string, body []byte, r *http.Request) error {
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		return verifyHMACSignature(sig, "sha256=", sha256.New, secret, body)
+	}
+	return verifyHMACSignature(r.Header.Get("X-Hub-Signature"), "sha1=", sha1.New, secret, body)
+}
+
+func (githubProvider) EventKind(r *http.Request) string {
+	if r.Header.Get("X-GitHub-Event") == pushKind {
+		return pushKind
+	}
+	return r.Header.Get("X-GitHub-Event")
+}
+
+// gitlabProvider implements GitLab's webhook protocol: a shared
+// secret compared directly against X-Gitlab-Token, no HMAC.
+type gitlabProvider struct{}
+
+func (gitlabProvider) Match(r *http.Request) bool {
+	return r.Header.Get("X-Gitlab-Event") != ""
+}
+
+func (gitlabProvider) Verify(secret string, body []byte, r *http.Request) error {
+	token := r.Header.Get("X-Gitlab-Token")
+	if token == "" || !hmac.Equal([]byte(token), []byte(secret)) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+func (gitlabProvider) EventKind(r *http.Request) string {
+	if r.Header.Get("X-Gitlab-Event") == "Push Hook" {
+		return pushKind
+	}
+	return r.Header.Get("X-Gitlab-Event")
+}
+
+// giteaProvider implements Gitea's webhook protocol: the
+// X-Gitea-Event/X-Gitea-Signature (HMAC-SHA256, hex, no prefix)
+// headers.
+type giteaProvider struct{}
+
+func (giteaProvider) Match(r *http.Request) bool {
+	return r.Header.Get("X-Gitea-Event") != ""
+}
+
+func (giteaProvider) Verify(secret string, body []byte, r *http.Request) error {
+	return verifyHMACSignature(r.Header.Get("X-Gitea-Signature"), "", sha256.New, secret, body)
+}
+
+func (giteaProvider) EventKind(r *http.Request) string {
+	if r.Header.Get("X-Gitea-Event") == pushKind {
+		return pushKind
+	}
+	return r.Header.Get("X-Gitea-Event")
+}
+
+// bitbucketProvider implements Bitbucket's webhook protocol:
+// X-Event-Key for the event kind, X-Hub-Signature (sha256=) for
+// authenticity.
+type bitbucketProvider struct{}
+
+func (bitbucketProvider) Match(r *http.Request) bool {
+	return r.Header.Get("X-Event-Key") != ""
+}
+
+func (bitbucketProvider) Verify(secret string, body []byte, r *http.Request) error {
+	return verifyHMACSignature(r.Header.Get("X-Hub-Signature"), "sha256=", sha256.New, secret, body)
+}
+
+func (bitbucketProvider) EventKind(r *http.Request) string {
+	if r.Header.Get("X-Event-Key") == "repo:push" {
+		return pushKind
+	}
+	return r.Header.Get("X-Event-Key")
+}
+
+// verifyHMACSignature checks that header, once prefix is stripped and
+// its hex-encoded digest decoded, is the HMAC of body keyed with
+// secret using newHash.
+func verifyHMACSignature(header, prefix string, newHash func() hash.Hash, secret string, body []byte) error {
+	if prefix != "" {
+		if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+			return errInvalidSignature
+		}
+		header = header[len(prefix):]
+	}
+	if header == "" {
+		return errInvalidSignature
+	}
+
+	actual, err := hex.DecodeString(header)
+	if err != nil {
+		return errInvalidSignature
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	if !hmac.Equal(expected, actual) {
+		return errInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testSecret = "my-secret"
+
+func sha1Signature(body, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sha256Signature(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestProviderFor(t *testing.T) {
+	tests := []struct {
+		name string
+		want Provider
+	}{
+		{"", githubProvider{}},
+		{providerGitHub, githubProvider{}},
+		{providerGitLab, gitlabProvider{}},
+		{providerGitea, giteaProvider{}},
+		{providerBitbucket, bitbucketProvider{}},
+	}
+
+	for _, test := range tests {
+		got, err := providerFor(test.name)
+		if err != nil {
+			t.Fatalf("providerFor(%q): unexpected error: %s", test.name, err)
+		}
+		if got != test.want {
+			t.Fatalf("providerFor(%q) = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := providerFor("unknown"); err != errUnknownProvider {
+		t.Fatalf("providerFor(%q): expected errUnknownProvider, got %v", "unknown", err)
+	}
+}
+
+func TestGitHubProviderVerify(t *testing.T) {
+	body := "push-body"
+
+	valid256 := httptest.NewRequest("POST", "/", nil)
+	valid256.Header.Set("X-Hub-Signature-256", "sha256="+sha256Signature(body, testSecret))
+
+	valid1 := httptest.NewRequest("POST", "/", nil)
+	valid1.Header.Set("X-Hub-Signature", "sha1="+sha1Signature(body, testSecret))
+
+	invalid := httptest.NewRequest("POST", "/", nil)
+	invalid.Header.Set("X-Hub-Signature", "sha1="+sha1Signature(body, "wrong-secret"))
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"valid sha256", valid256, false},
+		{"valid sha1", valid1, false},
+		{"invalid sha1", invalid, true},
+	}
+
+	for _, test := range tests {
+		err := githubProvider{}.Verify(testSecret, []byte(body), test.req)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Verify() error = %v, wantErr %t", test.name, err, test.wantErr)
+		}
+	}
+
+	match := httptest.NewRequest("POST", "/", nil)
+	match.Header.Set("X-GitHub-Event", "push")
+	if !(githubProvider{}).Match(match) {
+		t.Error("Expected Match to report true for a request carrying X-GitHub-Event")
+	}
+	if (githubProvider{}).Match(httptest.NewRequest("POST", "/", nil)) {
+		t.Error("Expected Match to report false for a request without X-GitHub-Event")
+	}
+}
+
+func TestGitLabProviderVerify(t *testing.T) {
+	valid := httptest.NewRequest("POST", "/", nil)
+	valid.Header.Set("X-Gitlab-Token", testSecret)
+
+	invalid := httptest.NewRequest("POST", "/", nil)
+	invalid.Header.Set("X-Gitlab-Token", "wrong-token")
+
+	missing := httptest.NewRequest("POST", "/", nil)
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"valid token", valid, false},
+		{"invalid token", invalid, true},
+		{"missing token", missing, true},
+	}
+
+	for _, test := range tests {
+		err := gitlabProvider{}.Verify(testSecret, nil, test.req)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Verify() error = %v, wantErr %t", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestGiteaProviderVerify(t *testing.T) {
+	body := "push-body"
+
+	valid := httptest.NewRequest("POST", "/", nil)
+	valid.Header.Set("X-Gitea-Signature", sha256Signature(body, testSecret))
+
+	invalid := httptest.NewRequest("POST", "/", nil)
+	invalid.Header.Set("X-Gitea-Signature", sha256Signature(body, "wrong-secret"))
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"valid signature", valid, false},
+		{"invalid signature", invalid, true},
+	}
+
+	for _, test := range tests {
+		err := giteaProvider{}.Verify(testSecret, []byte(body), test.req)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Verify() error = %v, wantErr %t", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestBitbucketProviderVerify(t *testing.T) {
+	body := "push-body"
+
+	valid := httptest.NewRequest("POST", "/", nil)
+	valid.Header.Set("X-Hub-Signature", "sha256="+sha256Signature(body, testSecret))
+
+	invalid := httptest.NewRequest("POST", "/", nil)
+	invalid.Header.Set("X-Hub-Signature", "sha256="+sha256Signature(body, "wrong-secret"))
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		wantErr bool
+	}{
+		{"valid signature", valid, false},
+		{"invalid signature", invalid, true},
+	}
+
+	for _, test := range tests {
+		err := bitbucketProvider{}.Verify(testSecret, []byte(body), test.req)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Verify() error = %v, wantErr %t", test.name, err, test.wantErr)
+		}
+	}
+
+	match := httptest.NewRequest("POST", "/", nil)
+	match.Header.Set("X-Event-Key", "repo:push")
+	if !(bitbucketProvider{}).Match(match) {
+		t.Error("Expected Match to report true for a request carrying X-Event-Key")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler runs repo updates in the background, capping how many run
+// at once across all repos and coalescing bursts of webhooks for the
+// same repo into a single extra run instead of queueing one per
+// webhook.
+type Scheduler struct {
+	sem chan struct{}
+}
+
+// newScheduler creates a Scheduler that runs at most maxConcurrent
+// updates at once. maxConcurrent <= 0 means unlimited.
+func newScheduler(maxConcurrent int) *Scheduler {
+	if maxConcurrent <= 0 {
+		return &Scheduler{}
+	}
+	return &Scheduler{sem: make(chan struct{}, maxConcurrent)}
+}
+
+var jobCounter uint64
+
+func nextJobID() string {
+	return strconv.FormatUint(atomic.AddUint64(&jobCounter, 1), 10)
+}
+
+// Trigger schedules an update of r. If r is already updating, this
+// run is coalesced into the one in progress rather than queued
+// separately, and the in-progress run's job id is returned. Otherwise
+// a new run is started in the background and its job id returned.
+func (s *Scheduler) Trigger(r *Repo) string {
+	r.queueMu.Lock()
+	if r.running {
+		r.pending = true
+		jobID := r.jobID
+		r.queueMu.Unlock()
+		return jobID
+	}
+
+	r.running = true
+	r.jobID = nextJobID()
+	jobID := r.jobID
+	r.queueMu.Unlock()
+
+	activeUpdates.Add(1)
+	go s.run(r)
+	return jobID
+}
+
+func (s *Scheduler) run(r *Repo) {
+	defer activeUpdates.Done()
+
+	if s.sem != nil {
+		s.sem <- struct{}{}
+		defer func() { <-s.sem }()
+	}
+
+	for {
+		start := time.Now()
+		err := r.updateOnce()
+		logWebhook(webhookLogEntry{
+			Repo:          r.Name,
+			Event:         "queued-update",
+			SignatureOK:   true,
+			DurationMS:    time.Since(start).Nanoseconds() / int64(time.Millisecond),
+			GitExitStatus: gitExitStatus(err),
+			Error:         errString(err),
+		})
+
+		r.queueMu.Lock()
+		if r.pending {
+			r.pending = false
+			r.queueMu.Unlock()
+			continue
+		}
+		r.running = false
+		r.queueMu.Unlock()
+		return
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
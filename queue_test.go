@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeVCS is a VCS whose first Fetch call blocks until proceed is
+// closed, so tests can hold an update "in progress" to exercise
+// Scheduler's coalescing. Every call is counted.
+type fakeVCS struct {
+	started   chan struct{}
+	proceed   chan struct{}
+	fetchOnce sync.Once
+
+	fetches int32
+}
+
+func (f *fakeVCS) Fetch() error {
+	atomic.AddInt32(&f.fetches, 1)
+	f.fetchOnce.Do(func() {
+		close(f.started)
+		<-f.proceed
+	})
+	return nil
+}
+
+func (f *fakeVCS) Reset() error                  { return nil }
+func (f *fakeVCS) Checkout(string) error         { return nil }
+func (f *fakeVCS) Pull() error                   { return nil }
+func (f *fakeVCS) Rebase() error                 { return nil }
+func (f *fakeVCS) FetchLFS() error               { return nil }
+func (f *fakeVCS) UpdateSubmodules(string) error { return nil }
+func (f *fakeVCS) CurrentRef() (string, error)   { return "", nil }
+
+// waitForQueueIdle polls r's queue status until it's no longer
+// running, failing the test if that takes too long.
+func waitForQueueIdle(t *testing.T, r *Repo) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if running, _ := r.QueueStatus(); !running {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the queued update to finish")
+}
+
+func TestSchedulerCoalescesOverlappingTriggers(t *testing.T) {
+	vcs := &fakeVCS{started: make(chan struct{}), proceed: make(chan struct{})}
+	repo := &Repo{Name: "username/repo", VCS: vcs}
+	scheduler := newScheduler(0)
+
+	firstJobID := scheduler.Trigger(repo)
+	if firstJobID == "" {
+		t.Fatal("Expected a job id for the first trigger")
+	}
+
+	<-vcs.started // The first update is now in progress.
+
+	// A burst of webhooks arriving while the update is in flight must
+	// all coalesce into the same run instead of queueing one each.
+	var wg sync.WaitGroup
+	jobIDs := make([]string, 5)
+	for i := range jobIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jobIDs[i] = scheduler.Trigger(repo)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, jobID := range jobIDs {
+		if jobID != firstJobID {
+			t.Fatalf("Expected coalesced trigger to return job id %s, but got %s", firstJobID, jobID)
+		}
+	}
+
+	if running, pending := repo.QueueStatus(); !running || !pending {
+		t.Fatalf("Expected running=true, pending=true, but got running=%t, pending=%t", running, pending)
+	}
+
+	close(vcs.proceed) // Let the in-progress update, and the coalesced one behind it, run.
+	waitForQueueIdle(t, repo)
+
+	if got := atomic.LoadInt32(&vcs.fetches); got != 2 {
+		t.Fatalf("Expected exactly 2 updates to run (1 original + 1 coalesced), but got %d", got)
+	}
+
+	if running, pending := repo.QueueStatus(); running || pending {
+		t.Fatalf("Expected running=false, pending=false once drained, but got running=%t, pending=%t", running, pending)
+	}
+}
+
+func TestSchedulerRunsSequentialTriggersSeparately(t *testing.T) {
+	vcs := &fakeVCS{started: make(chan struct{}), proceed: make(chan struct{})}
+	close(vcs.proceed) // Never block; each trigger should run to completion immediately.
+	repo := &Repo{Name: "username/repo", VCS: vcs}
+	scheduler := newScheduler(0)
+
+	firstJobID := scheduler.Trigger(repo)
+	waitForQueueIdle(t, repo)
+
+	secondJobID := scheduler.Trigger(repo)
+	waitForQueueIdle(t, repo)
+
+	if firstJobID == secondJobID {
+		t.Fatalf("Expected two sequential (non-overlapping) triggers to get distinct job ids, both got %s", firstJobID)
+	}
+	if got := atomic.LoadInt32(&vcs.fetches); got != 2 {
+		t.Fatalf("Expected 2 separate updates to run, but got %d", got)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"os/exec"
+	"regexp"
+)
+
+// Regexps used to dispatch smart-HTTP requests, analogous to the route
+// table git-http-backend itself uses to recognise these three
+// end-points.
+var (
+	infoRefsRoute    = regexp.MustCompile(`^/(.+)/info/refs$`)
+	uploadPackRoute  = regexp.MustCompile(`^/(.+)/git-upload-pack$`)
+	receivePackRoute = regexp.MustCompile(`^/(.+)/git-receive-pack$`)
+)
+
+const receivePackService = "git-receive-pack"
+
+// serveGit implements the Git smart-HTTP protocol against repos,
+// turning gitup into a mirror that can both receive push
+// notifications (via /update) and serve clones/fetches of the repos
+// it keeps up to date. Only repos with `serve = true` are exposed;
+// `allow_push = true` additionally allows git-receive-pack against
+// them.
+func serveGit(repos Repos, gitHTTPBackend string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repoName, push := matchRoute(r)
+		if repoName == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		repo := repos.FindRepo(repoName)
+		if repo == nil || !repo.Serve {
+			http.NotFound(w, r)
+			return
+		}
+
+		if push && !repo.AllowPush {
+			http.Error(w, "push is not allowed for this repo", http.StatusForbidden)
+			return
+		}
+
+		h := &cgi.Handler{
+			Path: gitHTTPBackend,
+			Root: "/" + repoName,
+			Dir:  repo.Path,
+			Env: []string{
+				"GIT_PROJECT_ROOT=" + repo.Path,
+				"GIT_HTTP_EXPORT_ALL=1",
+			},
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// matchRoute reports which repo, if any, r targets and whether it's a
+// push (git-receive-pack). An empty repoName means r doesn't match any
+// of the smart-HTTP routes.
+func matchRoute(r *http.Request) (repoName string, push bool) {
+	switch {
+	case r.Method == http.MethodGet && infoRefsRoute.MatchString(r.URL.Path):
+		m := infoRefsRoute.FindStringSubmatch(r.URL.Path)
+		return m[1], r.URL.Query().Get("service") == receivePackService
+	case r.Method == http.MethodPost && uploadPackRoute.MatchString(r.URL.Path):
+		m := uploadPackRoute.FindStringSubmatch(r.URL.Path)
+		return m[1], false
+	case r.Method == http.MethodPost && receivePackRoute.MatchString(r.URL.Path):
+		m := receivePackRoute.FindStringSubmatch(r.URL.Path)
+		return m[1], true
+	default:
+		return "", false
+	}
+}
+
+// getGitHTTPBackendPath looks up the git-http-backend CGI binary git
+// ships alongside itself, used to serve smart-HTTP requests. It's only
+// needed when at least one repo has `serve = true`.
+func getGitHTTPBackendPath() (string, error) {
+	return exec.LookPath("git-http-backend")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		query        string
+		wantRepoName string
+		wantPush     bool
+	}{
+		{"info/refs upload-pack", http.MethodGet, "/username/repo/info/refs", "service=git-upload-pack", "username/repo", false},
+		{"info/refs receive-pack", http.MethodGet, "/username/repo/info/refs", "service=git-receive-pack", "username/repo", true},
+		{"info/refs no service", http.MethodGet, "/username/repo/info/refs", "", "username/repo", false},
+		{"upload-pack", http.MethodPost, "/username/repo/git-upload-pack", "", "username/repo", false},
+		{"receive-pack", http.MethodPost, "/username/repo/git-receive-pack", "", "username/repo", true},
+		{"wrong method for info/refs", http.MethodPost, "/username/repo/info/refs", "", "", false},
+		{"wrong method for upload-pack", http.MethodGet, "/username/repo/git-upload-pack", "", "", false},
+		{"unrelated path", http.MethodGet, "/username/repo", "", "", false},
+		{"root", http.MethodGet, "/", "", "", false},
+	}
+
+	for _, test := range tests {
+		url := test.path
+		if test.query != "" {
+			url += "?" + test.query
+		}
+		req := httptest.NewRequest(test.method, url, nil)
+
+		repoName, push := matchRoute(req)
+		if repoName != test.wantRepoName || push != test.wantPush {
+			t.Errorf("%s: matchRoute(%s %s) = (%q, %t), want (%q, %t)",
+				test.name, test.method, url, repoName, push, test.wantRepoName, test.wantPush)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const (
+	driverCLI   = "cli"
+	driverGoGit = "gogit"
+
+	defaultRemote = "origin"
+	defaultBranch = "master"
+)
+
+var errUnknownDriver = errors.New("unknown driver, must be \"cli\" or \"gogit\"")
+
+// VCS abstracts the version control operations gitup needs to bring a
+// repo's working tree up to date with its upstream remote. CLIGit and
+// GoGitDriver are the two implementations; which one a repo uses is
+// picked with the `driver` config key.
+type VCS interface {
+	// Fetch downloads new objects and refs from the remote.
+	Fetch() error
+	// Reset makes the working tree match the remote's branch exactly,
+	// discarding any local changes.
+	Reset() error
+	// Checkout switches the working tree to branch.
+	Checkout(branch string) error
+	// Pull fetches and merges the remote branch into the working tree.
+	Pull() error
+	// Rebase fetches and replays local commits on top of the remote
+	// branch.
+	Rebase() error
+	// FetchLFS downloads any Git LFS objects referenced by the working
+	// tree and smudges them into place.
+	FetchLFS() error
+	// UpdateSubmodules brings the repo's submodules up to date. mode is
+	// "shallow" (top-level submodules only, depth-1 history) or
+	// "recursive" (nested submodules too, full history);
+	// UpdateSubmodules is not called for "none".
+	UpdateSubmodules(mode string) error
+	// CurrentRef returns the SHA the working tree currently has checked
+	// out.
+	CurrentRef() (string, error)
+}
+
+const (
+	modePull     = "pull"
+	modeReset    = "reset"
+	modeCheckout = "checkout"
+	modeRebase   = "rebase"
+)
+
+var errUnknownMode = errors.New("unknown mode, must be \"pull\", \"reset\", \"checkout\" or \"rebase\"")
+
+const (
+	submodulesNone      = "none"
+	submodulesShallow   = "shallow"
+	submodulesRecursive = "recursive"
+)
+
+var errUnknownSubmodules = errors.New("unknown submodules mode, must be \"none\", \"shallow\" or \"recursive\"")
+
+// runMode runs the update strategy configured for a repo through vcs.
+// checkout mode checks out branch directly; every other mode assumes
+// the caller has already fetched the remote.
+func runMode(vcs VCS, mode, branch string) error {
+	switch mode {
+	case "", modeReset:
+		return vcs.Reset()
+	case modePull:
+		return vcs.Pull()
+	case modeCheckout:
+		return vcs.Checkout(branch)
+	case modeRebase:
+		return vcs.Rebase()
+	default:
+		return errUnknownMode
+	}
+}
+
+// newVCS creates the VCS implementation configured for a repo. An empty
+// `driver` config key defaults to the CLI driver, preserving gitup's
+// original behaviour.
+func newVCS(conf map[string]string, path, gitPath string) (VCS, error) {
+	remote := conf["remote"]
+	if remote == "" {
+		remote = defaultRemote
+	}
+
+	branch := conf["branch"]
+	if branch == "" {
+		branch = defaultBranch
+	}
+
+	switch conf["driver"] {
+	case "", driverCLI:
+		return &CLIGit{
+			Path:    path,
+			GitPath: gitPath,
+			Remote:  remote,
+			Branch:  branch,
+		}, nil
+	case driverGoGit:
+		return &GoGitDriver{
+			Path:      path,
+			Remote:    remote,
+			Branch:    branch,
+			SSHKey:    conf["ssh_key"],
+			HTTPToken: conf["http_token"],
+		}, nil
+	default:
+		return nil, errUnknownDriver
+	}
+}
+
+// CLIGit is a VCS implementation that shells out to a git binary,
+// preserving gitup's original `git pull --force` behaviour.
+type CLIGit struct {
+	Path    string // Full path to the git repo.
+	GitPath string // Full path to the git command.
+	Remote  string
+	Branch  string
+}
+
+func (c *CLIGit) Fetch() error {
+	return c.run("fetch", c.Remote)
+}
+
+func (c *CLIGit) Reset() error {
+	return c.run("reset", "--hard", c.Remote+"/"+c.Branch)
+}
+
+func (c *CLIGit) Checkout(branch string) error {
+	return c.run("checkout", branch)
+}
+
+func (c *CLIGit) Pull() error {
+	return c.run("merge", "--ff-only", c.Remote+"/"+c.Branch)
+}
+
+func (c *CLIGit) Rebase() error {
+	return c.run("rebase", c.Remote+"/"+c.Branch)
+}
+
+func (c *CLIGit) FetchLFS() error {
+	if err := c.run("lfs", "fetch", "--all", c.Remote); err != nil {
+		return err
+	}
+	return c.run("lfs", "checkout")
+}
+
+func (c *CLIGit) UpdateSubmodules(mode string) error {
+	switch mode {
+	case submodulesShallow:
+		return c.run("submodule", "update", "--init", "--depth", "1")
+	case submodulesRecursive:
+		return c.run("submodule", "update", "--init", "--recursive")
+	default:
+		return errUnknownSubmodules
+	}
+}
+
+func (c *CLIGit) CurrentRef() (string, error) {
+	var buf bytes.Buffer
+	cmd := exec.Command(c.GitPath, "rev-parse", "HEAD")
+	cmd.Dir = c.Path
+	cmd.Stdout = &buf
+
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+func (c *CLIGit) run(args ...string) error {
+	var buf bytes.Buffer
+	cmd := exec.Command(c.GitPath, args...)
+	cmd.Dir = c.Path
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	if err := cmd.Run(); err != nil {
+		return errors.New(err.Error() + ": " + buf.String())
+	}
+	return nil
+}
+
+// GoGitDriver is a VCS implementation built on go-git, running the
+// fetch and reset in-process instead of shelling out to a git binary.
+// This lets gitup run in containers that don't ship a `git` binary.
+type GoGitDriver struct {
+	Path      string // Full path to the git repo.
+	Remote    string
+	Branch    string
+	SSHKey    string // Optional path to a private key for SSH remotes.
+	HTTPToken string // Optional bearer token for HTTP(S) remotes.
+}
+
+func (g *GoGitDriver) Fetch() error {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	auth, err := g.auth()
+	if err != nil {
+		return err
+	}
+
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: g.Remote,
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+func (g *GoGitDriver) Reset() error {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName(g.Remote, g.Branch), true)
+	if err != nil {
+		return err
+	}
+
+	return wt.Reset(&git.ResetOptions{
+		Commit: ref.Hash(),
+		Mode:   git.HardReset,
+	})
+}
+
+func (g *GoGitDriver) Checkout(branch string) error {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(branch),
+		Force:  true,
+	})
+}
+
+func (g *GoGitDriver) Pull() error {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	auth, err := g.auth()
+	if err != nil {
+		return err
+	}
+
+	err = wt.Pull(&git.PullOptions{
+		RemoteName:    g.Remote,
+		ReferenceName: plumbing.NewBranchReferenceName(g.Branch),
+		Auth:          auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+// Rebase is not supported by go-git, which has no rebase
+// implementation; repos that need it should use the CLI driver.
+func (g *GoGitDriver) Rebase() error {
+	return errors.New("rebase is not supported by the gogit driver, use driver = cli instead")
+}
+
+// FetchLFS drives the LFS batch API directly, since go-git has no LFS
+// client of its own: it finds the LFS pointer files go-git checked out
+// in place of the real objects, requests their download actions from
+// the remote's `/info/lfs/objects/batch` endpoint, and smudges the
+// downloaded content into place. Only http(s) remotes are supported.
+func (g *GoGitDriver) FetchLFS() error {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	return fetchLFS(repo, g.Path, g.Remote, g.HTTPToken)
+}
+
+func (g *GoGitDriver) UpdateSubmodules(mode string) error {
+	// Mirror CLIGit's semantics: shallow only updates the top-level
+	// submodules and shallow-clones them, recursive updates nested
+	// submodules too with their full history.
+	var recursion git.SubmoduleRescursivity
+	var depth int
+	switch mode {
+	case submodulesShallow:
+		recursion = git.NoRecurseSubmodules
+		depth = 1
+	case submodulesRecursive:
+		recursion = git.DefaultSubmoduleRecursionDepth
+	default:
+		return errUnknownSubmodules
+	}
+
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	subs, err := wt.Submodules()
+	if err != nil {
+		return err
+	}
+
+	auth, err := g.auth()
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		err := sub.Update(&git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: recursion,
+			Depth:             depth,
+			Auth:              auth,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GoGitDriver) CurrentRef() (string, error) {
+	repo, err := git.PlainOpen(g.Path)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// auth builds the go-git transport.AuthMethod for this repo's remote,
+// registering it with the pluggable transport/client registry so both
+// HTTP(S) and SSH remotes work without a system git binary.
+func (g *GoGitDriver) auth() (transport.AuthMethod, error) {
+	switch {
+	case g.SSHKey != "":
+		return ssh.NewPublicKeysFromFile("git", g.SSHKey, "")
+	case g.HTTPToken != "":
+		return &http.BasicAuth{Username: "gitup", Password: g.HTTPToken}, nil
+	default:
+		return nil, nil
+	}
+}